@@ -0,0 +1,83 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// boot records the applet's startup sequence.
+var boot bootLog
+
+// bootLog logs a concise, numbered summary of each step taken while the applet
+// starts up, so that there's a reliable first thing to read when a unit comes
+// up wrong.
+//
+// Once finish has been called further steps are ignored, this allows steps in
+// runWithNetworking to be reported the first time it runs without repeating
+// them each time the network is reconfigured.
+type bootLog struct {
+	mu       sync.Mutex
+	n        int
+	finished bool
+}
+
+// ok records that step completed successfully.
+func (b *bootLog) ok(step string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.finished {
+		return
+	}
+	b.n++
+	klog.Infof("BOOT %02d %-20s OK   +%v", b.n, step, uptime().Round(time.Millisecond))
+}
+
+// failed records that step failed with err, and that the applet will carry on,
+// possibly in a degraded mode.
+func (b *bootLog) failed(step string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.finished {
+		return
+	}
+	b.n++
+	klog.Errorf("BOOT %02d %-20s FAIL +%v: %v (continuing)", b.n, step, uptime().Round(time.Millisecond), err)
+}
+
+// fatal records that step failed with err, and exits the applet.
+func (b *bootLog) fatal(step string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.finished {
+		klog.Exitf("%s: %v", step, err)
+	}
+	b.n++
+	klog.Exitf("BOOT %02d %-20s FAIL +%v: %v (exiting)", b.n, step, uptime().Round(time.Millisecond), err)
+}
+
+// finish logs that startup has completed, and stops further steps being logged.
+func (b *bootLog) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.finished {
+		return
+	}
+	b.finished = true
+	klog.Infof("BOOT complete, %d steps in %v", b.n, uptime().Round(time.Millisecond))
+}
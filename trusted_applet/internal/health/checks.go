@@ -0,0 +1,97 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Tracker is an http.RoundTripper which records the time at which it last
+// received a response from an upstream server.
+//
+// Only 2xx responses count, since anything else may come from a captive portal
+// or proxy rejecting every request rather than from the intended server.
+type Tracker struct {
+	// Base is the RoundTripper used to make requests.
+	// If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// last holds the time of the last successful response, in Unix nanoseconds.
+	last atomic.Int64
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Tracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		t.last.Store(time.Now().UnixNano())
+	}
+	return resp, err
+}
+
+// LastSuccess returns the time at which the last successful response was
+// received, or the zero time if there hasn't been one.
+func (t *Tracker) LastSuccess() time.Time {
+	l := t.last.Load()
+	if l == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, l)
+}
+
+// RecentSuccess returns a precondition which is met if t has received a
+// successful response within the last maxAge.
+func RecentSuccess(t *Tracker, maxAge time.Duration) func() error {
+	return func() error {
+		l := t.LastSuccess()
+		if l.IsZero() {
+			return errors.New("no successful upstream response yet")
+		}
+		if age := time.Since(l); age > maxAge {
+			return fmt.Errorf("last successful upstream response was %v ago", age.Round(time.Second))
+		}
+		return nil
+	}
+}
+
+// ClockAfter returns a precondition which is met if the local clock reads
+// later than t.
+func ClockAfter(t time.Time) func() error {
+	return func() error {
+		if now := time.Now(); now.Before(t) {
+			return fmt.Errorf("clock not synced (%v)", now)
+		}
+		return nil
+	}
+}
+
+// NonEmpty returns a precondition which is met if f returns a non-empty
+// string. what describes the value, and is used in the error.
+func NonEmpty(what string, f func() string) func() error {
+	return func() error {
+		if f() == "" {
+			return fmt.Errorf("%s not set", what)
+		}
+		return nil
+	}
+}
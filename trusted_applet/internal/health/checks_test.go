@@ -0,0 +1,113 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		status      int
+		closed      bool
+		wantSuccess bool
+	}{
+		{
+			name:        "ok",
+			status:      http.StatusOK,
+			wantSuccess: true,
+		}, {
+			name:   "not found",
+			status: http.StatusNotFound,
+		}, {
+			name:   "unauthorized",
+			status: http.StatusUnauthorized,
+		}, {
+			name:   "forbidden",
+			status: http.StatusForbidden,
+		}, {
+			name:   "proxy authentication required",
+			status: http.StatusProxyAuthRequired,
+		}, {
+			name:   "server error",
+			status: http.StatusInternalServerError,
+		}, {
+			name:   "transport error",
+			closed: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(test.status)
+			}))
+			defer s.Close()
+			if test.closed {
+				s.Close()
+			}
+			tr := &Tracker{}
+			check := RecentSuccess(tr, time.Minute)
+			if err := check(); err == nil {
+				t.Fatal("RecentSuccess met before any requests were made")
+			}
+
+			resp, err := (&http.Client{Transport: tr}).Get(s.URL)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			if got, want := !tr.LastSuccess().IsZero(), test.wantSuccess; got != want {
+				t.Errorf("Got success recorded %t, want %t", got, want)
+			}
+			if got, want := check() == nil, test.wantSuccess; got != want {
+				t.Errorf("Got RecentSuccess met %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestRecentSuccessExpires(t *testing.T) {
+	tr := &Tracker{}
+	tr.last.Store(time.Now().Add(-time.Hour).UnixNano())
+	if err := RecentSuccess(tr, time.Minute)(); err == nil {
+		t.Error("RecentSuccess met by a response an hour old")
+	}
+	if err := RecentSuccess(tr, 2*time.Hour)(); err != nil {
+		t.Errorf("RecentSuccess not met by a response within maxAge: %v", err)
+	}
+}
+
+func TestClockAfter(t *testing.T) {
+	if err := ClockAfter(time.Now().Add(-time.Hour))(); err != nil {
+		t.Errorf("ClockAfter(past): %v", err)
+	}
+	if err := ClockAfter(time.Now().Add(time.Hour))(); err == nil {
+		t.Error("ClockAfter(future) met, want error")
+	}
+}
+
+func TestNonEmpty(t *testing.T) {
+	v := ""
+	check := NonEmpty("key", func() string { return v })
+	if err := check(); err == nil {
+		t.Error("NonEmpty met by empty value")
+	}
+	v = "set"
+	if err := check(); err != nil {
+		t.Errorf("NonEmpty not met by non-empty value: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health provides HTTP liveness and readiness probe handlers.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// response is the JSON body returned by the probe handlers.
+type response struct {
+	Status string `json:"status"`
+	// Failing maps the name of each unmet precondition to the reason it failed.
+	Failing map[string]string `json:"failing,omitempty"`
+}
+
+// Live is an http.HandlerFunc which always reports that the process is alive.
+func Live(w http.ResponseWriter, _ *http.Request) {
+	writeResponse(w, http.StatusOK, response{Status: "ok"})
+}
+
+// Readiness is an http.Handler which reports whether all of a set of
+// named preconditions are currently met.
+//
+// Preconditions must all be registered with Require before the handler
+// starts serving requests.
+type Readiness struct {
+	checks []check
+}
+
+type check struct {
+	name string
+	f    func() error
+}
+
+// Require adds a named precondition which must be met for the applet to be
+// considered ready. f should return a non-nil error describing why the
+// precondition is not met.
+func (r *Readiness) Require(name string, f func() error) {
+	r.checks = append(r.checks, check{name: name, f: f})
+}
+
+// Failing evaluates all preconditions, and returns the reasons for those
+// which are not met, keyed by name.
+func (r *Readiness) Failing() map[string]string {
+	failing := make(map[string]string)
+	for _, c := range r.checks {
+		if err := c.f(); err != nil {
+			failing[c.name] = err.Error()
+		}
+	}
+	return failing
+}
+
+// ServeHTTP responds with 200 if all preconditions are met, or 503 listing
+// those which are not.
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	if failing := r.Failing(); len(failing) > 0 {
+		writeResponse(w, http.StatusServiceUnavailable, response{Status: "unavailable", Failing: failing})
+		return
+	}
+	writeResponse(w, http.StatusOK, response{Status: "ok"})
+}
+
+func writeResponse(w http.ResponseWriter, code int, r response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(r)
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLive(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Live(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Fatalf("Got status %d, want %d", got, want)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		key, time   bool
+		wantCode    int
+		wantFailing []string
+	}{
+		{
+			name:     "all met",
+			key:      true,
+			time:     true,
+			wantCode: http.StatusOK,
+		}, {
+			name:        "no key",
+			time:        true,
+			wantCode:    http.StatusServiceUnavailable,
+			wantFailing: []string{"key"},
+		}, {
+			name:        "no time",
+			key:         true,
+			wantCode:    http.StatusServiceUnavailable,
+			wantFailing: []string{"time"},
+		}, {
+			name:        "none met",
+			wantCode:    http.StatusServiceUnavailable,
+			wantFailing: []string{"key", "time"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := &Readiness{}
+			r.Require("key", cond(test.key))
+			r.Require("time", cond(test.time))
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+			if got, want := rec.Code, test.wantCode; got != want {
+				t.Errorf("Got status %d, want %d", got, want)
+			}
+			resp := response{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to unmarshal response %q: %v", rec.Body.String(), err)
+			}
+			if got, want := len(resp.Failing), len(test.wantFailing); got != want {
+				t.Errorf("Got %d failing preconditions (%v), want %d", got, resp.Failing, want)
+			}
+			for _, n := range test.wantFailing {
+				if _, ok := resp.Failing[n]; !ok {
+					t.Errorf("Precondition %q not reported as failing: %v", n, resp.Failing)
+				}
+			}
+		})
+	}
+}
+
+// cond returns a precondition func which is met iff ok is true.
+func cond(ok bool) func() error {
+	return func() error {
+		if !ok {
+			return errors.New("not met")
+		}
+		return nil
+	}
+}
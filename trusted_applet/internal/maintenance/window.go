@@ -0,0 +1,94 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package maintenance provides a daily time window during which disruptive
+// work, such as installing firmware updates, is allowed to happen.
+package maintenance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// Window is a daily range of UTC times of day, from Start up to but not
+// including End.
+//
+// If End is earlier than Start the window wraps past midnight.
+//
+// A nil *Window is always open.
+type Window struct {
+	Start, End time.Duration
+}
+
+// Parse parses a window of the form "HH:MM-HH:MM", with times in UTC.
+// An empty string returns a nil window, which is always open.
+func Parse(s string) (*Window, error) {
+	if s == "" {
+		return nil, nil
+	}
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("maintenance window %q is not of the form HH:MM-HH:MM", s)
+	}
+	w := &Window{}
+	var err error
+	if w.Start, err = parseTimeOfDay(start); err != nil {
+		return nil, fmt.Errorf("invalid start of maintenance window %q: %v", s, err)
+	}
+	if w.End, err = parseTimeOfDay(end); err != nil {
+		return nil, fmt.Errorf("invalid end of maintenance window %q: %v", s, err)
+	}
+	if w.Start == w.End {
+		return nil, fmt.Errorf("maintenance window %q is empty", s)
+	}
+	return w, nil
+}
+
+// parseTimeOfDay parses an "HH:MM" time of day into an offset from midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains returns true if t falls within the window.
+func (w *Window) Contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	t = t.UTC()
+	tod := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	if w.Start < w.End {
+		return tod >= w.Start && tod < w.End
+	}
+	return tod >= w.Start || tod < w.End
+}
+
+// String returns the window in the form accepted by Parse.
+func (w *Window) String() string {
+	if w == nil {
+		return "always"
+	}
+	return fmt.Sprintf("%s-%s", formatTimeOfDay(w.Start), formatTimeOfDay(w.End))
+}
+
+func formatTimeOfDay(d time.Duration) string {
+	d %= day
+	return fmt.Sprintf("%02d:%02d", d/time.Hour, (d%time.Hour)/time.Minute)
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		want    *Window
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "02:00-04:30", want: &Window{Start: 2 * time.Hour, End: 4*time.Hour + 30*time.Minute}},
+		{in: "23:00-01:00", want: &Window{Start: 23 * time.Hour, End: time.Hour}},
+		{in: "00:00-23:59", want: &Window{Start: 0, End: 23*time.Hour + 59*time.Minute}},
+		{in: "02:00", wantErr: true},
+		{in: "02:00-", wantErr: true},
+		{in: "2am-4am", wantErr: true},
+		{in: "25:00-02:00", wantErr: true},
+		{in: "03:00-03:00", wantErr: true},
+	} {
+		t.Run(test.in, func(t *testing.T) {
+			got, err := Parse(test.in)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Parse(%q) = %v, want error %t", test.in, err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+				t.Errorf("Parse(%q) = %v, want %v", test.in, got, test.want)
+			}
+			if test.in != "" {
+				if got, want := got.String(), test.in; got != want {
+					t.Errorf("Got String() %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	at := func(h, m int) time.Time {
+		return time.Date(2024, time.March, 1, h, m, 0, 0, time.UTC)
+	}
+	for _, test := range []struct {
+		name   string
+		window string
+		t      time.Time
+		want   bool
+	}{
+		{name: "no window", window: "", t: at(12, 0), want: true},
+		{name: "before", window: "02:00-04:00", t: at(1, 59), want: false},
+		{name: "at start", window: "02:00-04:00", t: at(2, 0), want: true},
+		{name: "inside", window: "02:00-04:00", t: at(3, 0), want: true},
+		{name: "at end", window: "02:00-04:00", t: at(4, 0), want: false},
+		{name: "wrapping, before midnight", window: "23:00-01:00", t: at(23, 30), want: true},
+		{name: "wrapping, after midnight", window: "23:00-01:00", t: at(0, 30), want: true},
+		{name: "wrapping, at end", window: "23:00-01:00", t: at(1, 0), want: false},
+		{name: "wrapping, outside", window: "23:00-01:00", t: at(12, 0), want: false},
+		{name: "other zone", window: "02:00-04:00", t: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.FixedZone("+9", 9*60*60)), want: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			w, err := Parse(test.window)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", test.window, err)
+			}
+			if got := w.Contains(test.t); got != test.want {
+				t.Errorf("%v.Contains(%v) = %t, want %t", w, test.t, got, test.want)
+			}
+		})
+	}
+}
+
+// TestBuildValue checks the update window which is being compiled into the
+// applet, it's run by the check_build_vars target in the Makefile.
+func TestBuildValue(t *testing.T) {
+	w, ok := os.LookupEnv("UPDATE_WINDOW")
+	if !ok {
+		t.Skip("UPDATE_WINDOW not set")
+	}
+	if _, err := Parse(w); err != nil {
+		t.Fatalf("Invalid UPDATE_WINDOW: %v", err)
+	}
+}
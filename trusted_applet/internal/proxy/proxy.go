@@ -0,0 +1,50 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proxy configures outbound HTTP requests to be sent via a proxy.
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ForURL returns a function suitable for use as an http.Transport Proxy,
+// which sends all requests via the proxy at u.
+// If u is empty, a nil function is returned and requests are sent directly.
+//
+// The proxy URL is compiled into the applet firmware, which is published, so
+// URLs containing credentials are rejected.
+func ForURL(u string) (func(*http.Request) (*url.URL, error), error) {
+	if u == "" {
+		return nil, nil
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTP proxy URL: %v", err)
+	}
+	switch pu.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported HTTP proxy scheme %q", pu.Scheme)
+	}
+	if pu.User != nil {
+		return nil, fmt.Errorf("HTTP proxy URL %q must not contain credentials", pu.Redacted())
+	}
+	if pu.Host == "" {
+		return nil, fmt.Errorf("HTTP proxy URL %q has no host", u)
+	}
+	return http.ProxyURL(pu), nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package retry provides an HTTP transport which retries transient failures.
+package retry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxDrainBytes is the most that will be read from the body of a response
+// which is being retried in order to allow its connection to be reused.
+const maxDrainBytes = 4 << 10
+
+// Transport is an http.RoundTripper which retries idempotent requests that
+// fail with a network error or a transient (429 or 5xx) response status,
+// using jittered exponential back-off between attempts.
+//
+// Other errors, such as a TLS certificate which fails to verify, are returned
+// straight away.
+//
+// Only GET and HEAD requests for http or https URLs without a body are
+// retried; all other requests are passed through to the underlying
+// RoundTripper exactly once, so that submissions which the server may already
+// have accepted are never replayed.
+type Transport struct {
+	// Base is the RoundTripper used to make each attempt.
+	// If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// MaxAttempts is the maximum number of attempts made for a single request,
+	// including the first. Values less than 1 are treated as 1.
+	MaxAttempts int
+	// BaseDelay is the nominal delay before the first retry, this doubles with
+	// each subsequent retry up to MaxDelay.
+	// The actual delay is randomly chosen from [d/2, d) for a nominal delay d.
+	BaseDelay time.Duration
+	// MaxDelay caps the nominal delay between attempts.
+	// Zero means there is no cap.
+	MaxDelay time.Duration
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !idempotent(req) || !retryableScheme(req.URL) {
+		return base.RoundTrip(req)
+	}
+
+	d := t.BaseDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := base.RoundTrip(req)
+		if attempt >= t.MaxAttempts || !transient(resp, err) {
+			if err != nil && attempt > 1 {
+				err = fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return resp, err
+		}
+		if resp != nil {
+			// Drain the body so the underlying connection can be reused.
+			_, _ = io.CopyN(io.Discard, resp.Body, maxDrainBytes)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(jitter(d))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, fmt.Errorf("cancelled after %d attempts: %w", attempt, req.Context().Err())
+		case <-timer.C:
+		}
+		if d *= 2; t.MaxDelay > 0 && d > t.MaxDelay {
+			d = t.MaxDelay
+		}
+	}
+}
+
+// idempotent returns true if req may safely be sent more than once.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead:
+		return req.Body == nil || req.Body == http.NoBody
+	default:
+		return false
+	}
+}
+
+// retryableScheme returns true if requests to u are made over the network,
+// rather than by some other RoundTripper registered with the Base transport.
+func retryableScheme(u *url.URL) bool {
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// transient returns true if the outcome of an attempt is worth retrying.
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		return retryableError(err)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryableError returns true if err may be resolved by trying again.
+//
+// Only network errors, and connections closed before a complete response was
+// read, are retried. Anything else, such as a TLS certificate which fails to
+// verify or a proxy refusing the request, would fail the same way again.
+func retryableError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		verification     *tls.CertificateVerificationError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) ||
+		errors.As(err, &invalid) || errors.As(err, &verification) {
+		return false
+	}
+	var nErr net.Error
+	return errors.As(err, &nErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// jitter returns a random duration in [d/2, d).
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	h := d / 2
+	return h + rand.N(d-h)
+}
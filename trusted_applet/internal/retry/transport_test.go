@@ -0,0 +1,417 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyServer returns a test server which responds with 503 to the first
+// `failures` requests it receives, and with 200 "ok" thereafter, along with
+// a pointer to the number of requests it has seen.
+func flakyServer(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	n := &atomic.Int32{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if n.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(s.Close)
+	return s, n
+}
+
+func newClient(maxAttempts int) *http.Client {
+	return &http.Client{
+		Transport: &Transport{
+			MaxAttempts: maxAttempts,
+			BaseDelay:   time.Millisecond,
+			MaxDelay:    5 * time.Millisecond,
+		},
+	}
+}
+
+func TestRetries(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		method       string
+		failures     int32
+		maxAttempts  int
+		wantStatus   int
+		wantRequests int32
+	}{
+		{
+			name:         "succeeds first time",
+			method:       http.MethodGet,
+			maxAttempts:  3,
+			wantStatus:   http.StatusOK,
+			wantRequests: 1,
+		}, {
+			name:         "flaky GET succeeds",
+			method:       http.MethodGet,
+			failures:     2,
+			maxAttempts:  3,
+			wantStatus:   http.StatusOK,
+			wantRequests: 3,
+		}, {
+			name:         "flaky GET exhausts attempts",
+			method:       http.MethodGet,
+			failures:     5,
+			maxAttempts:  3,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantRequests: 3,
+		}, {
+			name:         "flaky HEAD succeeds",
+			method:       http.MethodHead,
+			failures:     1,
+			maxAttempts:  3,
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		}, {
+			name:         "POST is not retried",
+			method:       http.MethodPost,
+			failures:     1,
+			maxAttempts:  3,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantRequests: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s, n := flakyServer(t, test.failures)
+			var body io.Reader
+			if test.method == http.MethodPost {
+				body = strings.NewReader("checkpoint")
+			}
+			req, err := http.NewRequest(test.method, s.URL, body)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			resp, err := newClient(test.maxAttempts).Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			_ = resp.Body.Close()
+			if got, want := resp.StatusCode, test.wantStatus; got != want {
+				t.Errorf("Got status %d, want %d", got, want)
+			}
+			if got, want := n.Load(), test.wantRequests; got != want {
+				t.Errorf("Server saw %d requests, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestTransportErrorReportsAttempts(t *testing.T) {
+	s, _ := flakyServer(t, 0)
+	// Close the server so that all attempts fail to connect.
+	s.Close()
+
+	_, err := newClient(3).Get(s.URL)
+	if err == nil {
+		t.Fatal("Get succeeded, want error")
+	}
+	if !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("Error %q does not report attempt count", err)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	s, n := flakyServer(t, 100)
+	c := &http.Client{
+		Transport: &Transport{
+			MaxAttempts: 100,
+			BaseDelay:   time.Hour,
+			MaxDelay:    time.Hour,
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	start := time.Now()
+	_, err = c.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("Do took %v to honour cancellation", d)
+	}
+	if got := n.Load(); got != 1 {
+		t.Errorf("Server saw %d requests, want 1", got)
+	}
+}
+
+// countingTransport is a RoundTripper which fails every request with err,
+// and counts the requests made.
+type countingTransport struct {
+	err error
+	n   int
+}
+
+func (c *countingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	c.n++
+	return nil, c.err
+}
+
+func TestErrorClassification(t *testing.T) {
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	for _, test := range []struct {
+		name         string
+		url          string
+		err          error
+		wantRequests int
+	}{
+		{
+			name:         "network error",
+			url:          "https://example.com/checkpoint",
+			err:          netErr,
+			wantRequests: 3,
+		}, {
+			name:         "unexpected EOF",
+			url:          "https://example.com/checkpoint",
+			err:          fmt.Errorf("reading response: %w", io.ErrUnexpectedEOF),
+			wantRequests: 3,
+		}, {
+			name:         "other error",
+			url:          "https://example.com/checkpoint",
+			err:          errors.New("unsupported protocol"),
+			wantRequests: 1,
+		}, {
+			name:         "unknown certificate authority",
+			url:          "https://example.com/checkpoint",
+			err:          fmt.Errorf("tls: %w", x509.UnknownAuthorityError{}),
+			wantRequests: 1,
+		}, {
+			name:         "certificate for wrong host",
+			url:          "https://example.com/checkpoint",
+			err:          x509.HostnameError{Host: "example.com"},
+			wantRequests: 1,
+		}, {
+			name:         "expired certificate",
+			url:          "https://example.com/checkpoint",
+			err:          x509.CertificateInvalidError{Reason: x509.Expired},
+			wantRequests: 1,
+		}, {
+			name:         "non-network scheme",
+			url:          "file:///checkpoint",
+			err:          netErr,
+			wantRequests: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			base := &countingTransport{err: test.err}
+			tr := &Transport{Base: base, MaxAttempts: 3, BaseDelay: time.Millisecond}
+			req, err := http.NewRequest(http.MethodGet, test.url, nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			if _, err := tr.RoundTrip(req); err == nil {
+				t.Fatal("RoundTrip succeeded, want error")
+			}
+			if got, want := base.n, test.wantRequests; got != want {
+				t.Errorf("Got %d requests, want %d", got, want)
+			}
+		})
+	}
+}
+
+// attemptCounter is a RoundTripper which counts the requests passed to Base.
+type attemptCounter struct {
+	Base http.RoundTripper
+	n    atomic.Int32
+}
+
+func (a *attemptCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	a.n.Add(1)
+	return a.Base.RoundTrip(req)
+}
+
+// quietServer returns a started test server whose own error logging, such as
+// for failed TLS handshakes, is discarded.
+func quietServer(t *testing.T, h http.Handler, tls bool) *httptest.Server {
+	t.Helper()
+	s := httptest.NewUnstartedServer(h)
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	if tls {
+		s.StartTLS()
+	} else {
+		s.Start()
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// TestRealTransportErrors checks the classification of errors as returned by
+// an http.Transport, which unlike http.Client does not wrap them in a
+// *url.Error.
+func TestRealTransportErrors(t *testing.T) {
+	empty := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	hangUp := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		c, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = c.Close()
+		}
+	})
+	malformed := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		c, b, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		_, _ = b.WriteString("HTTP/1.1 200 OK\r\nContent-Le")
+		_ = b.Flush()
+		_ = c.Close()
+	})
+	proxyAuth := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	})
+
+	for _, test := range []struct {
+		name string
+		// setup returns the transport and URL to use for the request.
+		setup        func(t *testing.T) (*http.Transport, string)
+		wantRequests int32
+	}{
+		{
+			name: "connection refused",
+			setup: func(t *testing.T) (*http.Transport, string) {
+				s := quietServer(t, empty, false)
+				s.Close()
+				return &http.Transport{}, s.URL
+			},
+			wantRequests: 3,
+		}, {
+			name: "connection closed without response",
+			setup: func(t *testing.T) (*http.Transport, string) {
+				return &http.Transport{}, quietServer(t, hangUp, false).URL
+			},
+			wantRequests: 3,
+		}, {
+			name: "malformed response",
+			setup: func(t *testing.T) (*http.Transport, string) {
+				return &http.Transport{}, quietServer(t, malformed, false).URL
+			},
+			wantRequests: 1,
+		}, {
+			name: "TLS to a plain HTTP server",
+			setup: func(t *testing.T) (*http.Transport, string) {
+				return &http.Transport{}, "https://" + strings.TrimPrefix(quietServer(t, empty, false).URL, "http://")
+			},
+			wantRequests: 1,
+		}, {
+			name: "unknown certificate authority",
+			setup: func(t *testing.T) (*http.Transport, string) {
+				return &http.Transport{}, quietServer(t, empty, true).URL
+			},
+			wantRequests: 1,
+		}, {
+			name: "proxy requires authentication",
+			setup: func(t *testing.T) (*http.Transport, string) {
+				p, err := url.Parse(quietServer(t, proxyAuth, false).URL)
+				if err != nil {
+					t.Fatalf("Parse: %v", err)
+				}
+				return &http.Transport{Proxy: http.ProxyURL(p)}, "https://example.com/checkpoint"
+			},
+			wantRequests: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			base, u := test.setup(t)
+			defer base.CloseIdleConnections()
+			counter := &attemptCounter{Base: base}
+			tr := &Transport{Base: counter, MaxAttempts: 3, BaseDelay: time.Millisecond}
+			req, err := http.NewRequest(http.MethodGet, u, nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			if _, err := tr.RoundTrip(req); err == nil {
+				t.Fatal("RoundTrip succeeded, want error")
+			}
+			if got, want := counter.n.Load(), test.wantRequests; got != want {
+				t.Errorf("Got %d requests, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestNoMaxDelay(t *testing.T) {
+	base := &countingTransport{err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	tr := &Transport{Base: base, MaxAttempts: 3, BaseDelay: 20 * time.Millisecond}
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/checkpoint", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	start := time.Now()
+	_, _ = tr.RoundTrip(req)
+	// With no cap the two delays are at least 10ms and 20ms, were MaxDelay of
+	// 0 treated as a cap there would be no delay at all.
+	if d, min := time.Since(start), 30*time.Millisecond; d < min {
+		t.Errorf("Retries took %v, want at least %v", d, min)
+	}
+}
+
+func TestDrainIsBounded(t *testing.T) {
+	body := &countingReader{}
+	tr := &Transport{
+		Base: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(body)}, nil
+		}),
+		MaxAttempts: 2,
+		BaseDelay:   time.Millisecond,
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/checkpoint", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if got, max := body.n, int64(maxDrainBytes); got > max {
+		t.Errorf("Drained %d bytes, want at most %d", got, max)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// countingReader is an endless reader which counts the bytes read from it.
+type countingReader struct {
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -323,6 +323,73 @@ func TestUpdateVerifies(t *testing.T) {
 	}
 }
 
+func TestTornWriteRecovers(t *testing.T) {
+	for _, keep := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("keep %d blocks", keep), func(t *testing.T) {
+			storageBlocks := uint(20)
+			md := testonly.NewMemDev(t, storageBlocks)
+			start, length := uint(1), storageBlocks-1
+
+			j, err := OpenJournal(md, start, length)
+			if err != nil {
+				t.Fatalf("OpenJournal: %v", err)
+			}
+			good := fill(100, "good")
+			if err := j.Update(good); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+
+			// Write a 3 block entry, then roll back all but the first `keep` of
+			// the blocks it touched to simulate power being lost mid-write.
+			before := append([][testonly.MemBlockSize]byte{}, md.Storage...)
+			var written []uint
+			md.OnBlockWritten = func(lba uint) {
+				written = append(written, lba)
+			}
+			if err := j.Update(fill(1000, "torn")); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			md.OnBlockWritten = nil
+			if got, want := len(written), 3; got != want {
+				t.Fatalf("Update wrote %d blocks, want %d", got, want)
+			}
+			for _, lba := range written[keep:] {
+				md.Storage[lba] = before[lba]
+			}
+
+			// Reopening should recover the last complete entry.
+			j, err = OpenJournal(md, start, length)
+			if err != nil {
+				t.Fatalf("OpenJournal: %v", err)
+			}
+			data, rev := j.Data()
+			if rev != 1 {
+				t.Errorf("Got revision %d, want 1", rev)
+			}
+			if !bytes.Equal(data, good) {
+				t.Errorf("Got data %q, want %q", string(data), string(good))
+			}
+
+			// And the journal should remain writable.
+			next := fill(200, "next")
+			if err := j.Update(next); err != nil {
+				t.Fatalf("Update after recovery: %v", err)
+			}
+			j, err = OpenJournal(md, start, length)
+			if err != nil {
+				t.Fatalf("OpenJournal: %v", err)
+			}
+			data, rev = j.Data()
+			if rev != 2 {
+				t.Errorf("Got revision %d, want 2", rev)
+			}
+			if !bytes.Equal(data, next) {
+				t.Errorf("Got data %q, want %q", string(data), string(next))
+			}
+		})
+	}
+}
+
 // fill returns a slice of length n containing as many repeats of s as necessary
 // to fill it (including partial at the end if needed).
 func fill(n int, s string) []byte {
@@ -0,0 +1,41 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package witnesskey provides an HTTP handler which serves the witness's
+// public key.
+package witnesskey
+
+import (
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+// Handler returns an http.Handler which serves the witness verifier key
+// returned by vkey, in note format, as a single line of plain text.
+//
+// Only GET and HEAD requests are accepted.
+func Handler(vkey func() string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := w.Write([]byte(vkey() + "\n")); err != nil {
+			klog.Warningf("Failed to write witness key response: %v", err)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 The Armored Witness Applet authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package witnesskey
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestHandler(t *testing.T) {
+	_, vkey, err := note.GenerateKey(rand.Reader, "test.witness")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	want, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	h := Handler(func() string { return vkey })
+
+	for _, test := range []struct {
+		method   string
+		wantCode int
+	}{
+		{method: http.MethodGet, wantCode: http.StatusOK},
+		{method: http.MethodHead, wantCode: http.StatusOK},
+		{method: http.MethodPost, wantCode: http.StatusMethodNotAllowed},
+	} {
+		t.Run(test.method, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(test.method, "/witness/key", nil))
+			if got, want := rec.Code, test.wantCode; got != want {
+				t.Fatalf("Got status %d, want %d", got, want)
+			}
+			if test.wantCode != http.StatusOK {
+				if got, want := rec.Header().Get("Allow"), "GET, HEAD"; got != want {
+					t.Errorf("Got Allow %q, want %q", got, want)
+				}
+				return
+			}
+			got, err := note.NewVerifier(strings.TrimSuffix(rec.Body.String(), "\n"))
+			if err != nil {
+				t.Fatalf("NewVerifier(%q): %v", rec.Body.String(), err)
+			}
+			if got.Name() != want.Name() || got.KeyHash() != want.KeyHash() {
+				t.Errorf("Got verifier %s+%08x, want %s+%08x", got.Name(), got.KeyHash(), want.Name(), want.KeyHash())
+			}
+		})
+	}
+}
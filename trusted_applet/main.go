@@ -18,12 +18,13 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"regexp"
 	"runtime"
+	"runtime/metrics"
 	"sync"
+	"sync/atomic"
 
 	"strings"
 	"time"
@@ -38,8 +39,11 @@ import (
 	"google.golang.org/protobuf/proto"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 
+	"github.com/transparency-dev/armored-witness-applet/trusted_applet/internal/health"
+	"github.com/transparency-dev/armored-witness-applet/trusted_applet/internal/maintenance"
 	"github.com/transparency-dev/armored-witness-applet/trusted_applet/internal/storage"
 	"github.com/transparency-dev/armored-witness-applet/trusted_applet/internal/storage/slots"
+	"github.com/transparency-dev/armored-witness-applet/trusted_applet/internal/witnesskey"
 	"github.com/transparency-dev/armored-witness-common/release/firmware/update"
 	"github.com/transparency-dev/armored-witness-os/api"
 	"github.com/transparency-dev/armored-witness-os/api/rpc"
@@ -71,6 +75,16 @@ const (
 	// updateCheckInterval is the time between checking the FT Log for firmware
 	// updates.
 	updateCheckInterval = 5 * time.Minute
+
+	// upstreamMaxAge is how long the witness may go without a successful
+	// outbound HTTP request before it stops reporting itself as ready.
+	// The witness polls its logs every 30 seconds, so this allows for a few
+	// consecutive failures.
+	upstreamMaxAge = 2 * time.Minute
+
+	// witnessStartupGrace is how long omniwitness.Main must run without
+	// failing before the witness is logged as started.
+	witnessStartupGrace = 10 * time.Second
 )
 
 var (
@@ -82,6 +96,15 @@ var (
 	cfg *api.Configuration
 
 	persistence *storage.SlotPersistence
+
+	// bootTime holds the time the applet started, in Unix nanoseconds.
+	// It is shifted along with the clock whenever NTP steps it, so that
+	// uptime remains correct.
+	bootTime atomic.Int64
+
+	// earliestPlausibleTime is a time before which the local clock is assumed
+	// not to have been set yet.
+	earliestPlausibleTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
 )
 
 var (
@@ -102,14 +125,41 @@ func initMetrics() {
 		// error for dupes.
 		prom.Unregister(prom.NewGoCollector())
 		prom.Register(collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(collectors.GoRuntimeMetricsRule{Matcher: regexp.MustCompile("/.*")})))
+		// These are registered directly as GaugeFuncs so they're only evaluated
+		// when scraped.
+		prom.MustRegister(prom.NewGaugeFunc(prom.GaugeOpts{
+			Name: "omniwitness_uptime_seconds",
+			Help: "Number of seconds since the applet started",
+		}, func() float64 {
+			return uptime().Seconds()
+		}))
+		prom.MustRegister(prom.NewGaugeFunc(prom.GaugeOpts{
+			Name: "omniwitness_ram_unmapped_bytes",
+			Help: "Number of bytes of applet RAM not yet mapped by the Go runtime. Note that this includes the RAM occupied by the applet image itself.",
+		}, func() float64 {
+			// Unlike runtime.ReadMemStats, this doesn't stop the world.
+			s := []metrics.Sample{{Name: "/memory/classes/total:bytes"}}
+			metrics.Read(s)
+			if s[0].Value.Kind() != metrics.KindUint64 {
+				return 0
+			}
+			return float64(appletSize) - float64(s[0].Value.Uint64())
+		}))
 	})
 }
 
+// uptime returns the time elapsed since the applet started.
+func uptime() time.Duration {
+	return time.Since(time.Unix(0, bootTime.Load()))
+}
+
 func init() {
 	runtime.Exit = applet.Exit
 }
 
 func main() {
+	bootTime.Store(time.Now().UnixNano())
+
 	klog.InitFlags(nil)
 	flag.Set("vmodule", "journal=1,slots=1,storage=1")
 	flag.Set("logtostderr", "true")
@@ -131,8 +181,9 @@ func main() {
 	// Verify if we are allowed to run on this unit by sending version
 	// information for rollback protection check.
 	if err := syscall.Call("RPC.Version", strings.TrimPrefix(Version, "v"), nil); err != nil {
-		log.Fatalf("TA version check error for version %q: %v", Version, err)
+		boot.fatal("version check", fmt.Errorf("TA version check error for version %q: %v", Version, err))
 	}
+	boot.ok("version check")
 	// Set default configuration, the applet is reponsible of implementing
 	// its own configuration storage strategy.
 	cfg = &api.Configuration{
@@ -156,19 +207,21 @@ func main() {
 	// received one.
 	var cfgResp []byte
 	if err := syscall.Call("RPC.Config", cfg.Bytes(), &cfgResp); err != nil {
-		klog.Errorf("TA configuration error, %v", err)
-	}
-
-	if len(cfgResp) > 0 {
-		if err := proto.Unmarshal(cfgResp, cfg); err != nil {
-			log.Fatalf("TA configuration invalid: %v", err)
+		boot.failed("config", fmt.Errorf("TA configuration error, using defaults: %v", err))
+	} else {
+		if len(cfgResp) > 0 {
+			if err := proto.Unmarshal(cfgResp, cfg); err != nil {
+				boot.fatal("config", fmt.Errorf("TA configuration invalid: %v", err))
+			}
 		}
+		boot.ok("config")
 	}
 	var status api.Status
 
 	if err := syscall.Call("RPC.Status", nil, &status); err != nil {
-		log.Fatalf("TA status error, %v", err)
+		boot.fatal("status", fmt.Errorf("TA status error, %v", err))
 	}
+	boot.ok("status")
 
 	for _, line := range strings.Split(status.Print(), "\n") {
 		klog.Info(line)
@@ -179,6 +232,7 @@ func main() {
 
 	// (Re-)create our witness identity based on the device's internal secret key.
 	deriveIdentityKeys()
+	boot.ok("identity keys")
 	// Update our status in OS so custodian can inspect our signing identity even if there's no network.
 	syscall.Call("RPC.SetWitnessStatus", rpc.WitnessStatus{
 		Identity:          witnessPublicKey,
@@ -199,8 +253,9 @@ func main() {
 	}()
 
 	if err := startNetworking(); err != nil {
-		log.Fatalf("TA could not initialize networking, %v", err)
+		boot.fatal("network stack", fmt.Errorf("TA could not initialize networking, %v", err))
 	}
+	boot.ok("network stack")
 
 	syscall.Call("RPC.Address", iface.NIC.MAC, nil)
 
@@ -209,7 +264,7 @@ func main() {
 
 	klog.Infof("Opening storage...")
 	part := openStorage()
-	klog.Infof("Storage opened.")
+	boot.ok("storage")
 
 	// Set this to true to "wipe" the storage.
 	// Currently this simply force-writes an entry with zero bytes to
@@ -229,8 +284,9 @@ func main() {
 
 	persistence = storage.NewSlotPersistence(part)
 	if err := persistence.Init(); err != nil {
-		klog.Exitf("Failed to create persistence layer: %v", err)
+		boot.fatal("persistence", fmt.Errorf("Failed to create persistence layer: %v", err))
 	}
+	boot.ok("persistence")
 	persistence.Init()
 
 	// Wait for a DHCP address to be assigned if that's what we're configured to do
@@ -287,7 +343,7 @@ func runWithNetworking(ctx context.Context) error {
 	// Avoid the situation where, at boot, we get a DHCP lease and then immediately update our
 	// local clock from 1970 to now, whereupon we consider the DHCP lease invalid and have to tear down
 	// the witness etc. below.
-	coldStart := time.Now().Before(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	coldStart := time.Now().Before(earliestPlausibleTime)
 
 	select {
 	case <-runNTP(ctx):
@@ -300,6 +356,7 @@ func runWithNetworking(ctx context.Context) error {
 	case <-ctx.Done():
 		return ctx.Err()
 	}
+	boot.ok("time sync")
 
 	triggerUpdate := updateChecker(ctx, updateCheckInterval)
 
@@ -307,8 +364,10 @@ func runWithNetworking(ctx context.Context) error {
 
 	adminListener, err := listenCfg.Listen(ctx, "tcp", ":8081")
 	if err != nil {
+		boot.failed("admin listener", err)
 		return fmt.Errorf("TA could not initialize admin listener, %v", err)
 	}
+	boot.ok("admin listener")
 	defer func() {
 		klog.Info("Closing admin port (8081)")
 		if err := adminListener.Close(); err != nil {
@@ -316,12 +375,20 @@ func runWithNetworking(ctx context.Context) error {
 		}
 	}()
 	go func() {
+		ready := &health.Readiness{}
+		ready.Require("signing_key", health.NonEmpty("witness signing key", func() string { return witnessSigningKey }))
+		ready.Require("time", health.ClockAfter(earliestPlausibleTime))
+		ready.Require("upstream", health.RecentSuccess(upstream, upstreamMaxAge))
+
 		srvMux := http.NewServeMux()
 		srvMux.Handle("/metrics", promhttp.Handler())
+		srvMux.HandleFunc("/healthz", health.Live)
+		srvMux.Handle("/readyz", ready)
 		srvMux.Handle("/crashlog", &logHandler{RPC: "RPC.CrashLog"})
 		srvMux.Handle("/consolelog", &logHandler{RPC: "RPC.ConsoleLog"})
+		srvMux.Handle("/witness/key", witnesskey.Handler(func() string { return witnessPublicKey }))
 		srvMux.HandleFunc("/updatecheck", func(w http.ResponseWriter, _ *http.Request) {
-			triggerUpdate <- struct{}{}
+			triggerUpdate <- true
 			w.Header().Add("Content-Type", "text/plain")
 			w.Write([]byte("ok, check /consolelog!"))
 		})
@@ -344,8 +411,10 @@ func runWithNetworking(ctx context.Context) error {
 	}
 	mainListener, err := listenCfg.Listen(ctx, "tcp", ":80")
 	if err != nil {
+		boot.failed("witness listener", err)
 		return fmt.Errorf("could not initialize HTTP listener: %v", err)
 	}
+	boot.ok("witness listener")
 	defer func() {
 		if err := mainListener.Close(); err != nil {
 			klog.Errorf("mainListener: %v", err)
@@ -355,19 +424,51 @@ func runWithNetworking(ctx context.Context) error {
 	klog.Info("Starting witness...")
 	klog.Infof("I am %q", witnessPublicKey)
 	counterWitnessStarted.Inc()
-	if err := omniwitness.Main(ctx, opConfig, persistence, mainListener, http.DefaultClient); err != nil {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- omniwitness.Main(ctx, opConfig, persistence, mainListener, http.DefaultClient)
+	}()
+
+	// omniwitness.Main only returns once the witness stops, so consider it
+	// started once it has run for witnessStartupGrace without returning.
+	select {
+	case err := <-errc:
+		if err != nil {
+			boot.failed("witness", err)
+			boot.finish()
+			return fmt.Errorf("omniwitness.Main failed: %v", err)
+		}
+		boot.failed("witness", fmt.Errorf("stopped during startup: %v", ctx.Err()))
+		boot.finish()
+		return ctx.Err()
+	case <-time.After(witnessStartupGrace):
+		boot.ok("witness")
+		boot.finish()
+	}
+	if err := <-errc; err != nil {
 		return fmt.Errorf("omniwitness.Main failed: %v", err)
 	}
 
 	return ctx.Err()
 }
 
-func updateChecker(ctx context.Context, i time.Duration) chan<- struct{} {
+func updateChecker(ctx context.Context, i time.Duration) chan<- bool {
 	var updateFetcher *update.Fetcher
 	var updateClient *update.Updater
 	var err error
 
-	trigger := make(chan struct{}, 1)
+	// An invalid window should have been caught by the Makefile, if one gets
+	// through then only install updates when explicitly asked to.
+	autoInstall := true
+	window, err := maintenance.Parse(updateWindow)
+	if err != nil {
+		klog.Errorf("Invalid update window, updates will only be installed via /updatecheck: %v", err)
+		autoInstall = false
+	}
+
+	// Values sent to trigger indicate whether the update should be installed
+	// even if it's outside of the update window.
+	trigger := make(chan bool, 1)
 
 	go func(ctx context.Context) {
 		t := time.NewTicker(i)
@@ -375,7 +476,7 @@ func updateChecker(ctx context.Context, i time.Duration) chan<- struct{} {
 		for {
 			select {
 			case <-t.C:
-				trigger <- struct{}{}
+				trigger <- false
 			case <-ctx.Done():
 				close(trigger)
 				return
@@ -386,7 +487,7 @@ func updateChecker(ctx context.Context, i time.Duration) chan<- struct{} {
 	go func(ctx context.Context) {
 		for {
 			select {
-			case _, ok := <-trigger:
+			case force, ok := <-trigger:
 				if !ok {
 					return
 				}
@@ -403,6 +504,10 @@ func updateChecker(ctx context.Context, i time.Duration) chan<- struct{} {
 					klog.Errorf("UpdateFetcher.Scan: %v", err)
 					continue
 				}
+				if now := time.Now(); !force && (!autoInstall || !window.Contains(now)) {
+					klog.V(1).Infof("Outside update window %v at %v, deferring any update", window, now.UTC().Format("15:04"))
+					continue
+				}
 				if err := updateClient.Update(ctx); err != nil {
 					klog.Errorf("Update: %v", err)
 				}
@@ -38,6 +38,9 @@ import (
 
 	"github.com/beevik/ntp"
 	"github.com/transparency-dev/armored-witness-applet/third_party/dhcp"
+	"github.com/transparency-dev/armored-witness-applet/trusted_applet/internal/health"
+	"github.com/transparency-dev/armored-witness-applet/trusted_applet/internal/proxy"
+	"github.com/transparency-dev/armored-witness-applet/trusted_applet/internal/retry"
 	"github.com/transparency-dev/armored-witness-os/api"
 	"go.mercari.io/go-dnscache"
 
@@ -60,9 +63,18 @@ const (
 	// Timeout for any http requests.
 	httpTimeout = 30 * time.Second
 
+	// Retry settings for idempotent http requests.
+	httpMaxAttempts    = 3
+	httpRetryBaseDelay = 500 * time.Millisecond
+	httpRetryMaxDelay  = 5 * time.Second
+
 	// DNS cache settings.
 	dnsUpdateFreq    = 1 * time.Minute
 	dnsUpdateTimeout = 5 * time.Second
+
+	// Timeouts for resolving and querying the NTP server.
+	ntpLookupTimeout = 5 * time.Second
+	ntpQueryTimeout  = 5 * time.Second
 )
 
 // Trusted OS syscalls
@@ -75,6 +87,15 @@ const (
 
 var (
 	iface *enet.Interface
+
+	// httpProxyURL is set at compile time using the -X flag, see the Makefile.
+	// If non-empty, all outbound HTTP requests are sent via this proxy, which
+	// must not require credentials.
+	httpProxyURL string
+
+	// upstream is the transport used by http.DefaultClient, it records when
+	// an outbound HTTP request last succeeded.
+	upstream *health.Tracker
 )
 
 func init() {
@@ -225,14 +246,16 @@ func runNTP(ctx context.Context) chan bool {
 			case <-time.After(i):
 			}
 
-			ip, err := net.DefaultResolver.LookupIP(ctx, "ip4", cfg.NTPServer)
+			lookupCtx, cancel := context.WithTimeout(ctx, ntpLookupTimeout)
+			ip, err := net.DefaultResolver.LookupIP(lookupCtx, "ip4", cfg.NTPServer)
+			cancel()
 			if err != nil {
-				klog.Errorf("Failed to resolve NTP server %q: %v", DefaultNTP, err)
+				klog.Errorf("Failed to resolve NTP server %q: %v", cfg.NTPServer, err)
 				continue
 			}
 			ntpR, err := ntp.QueryWithOptions(
 				ip[0].String(),
-				ntp.QueryOptions{},
+				ntp.QueryOptions{Timeout: ntpQueryTimeout},
 			)
 			if err != nil {
 				klog.Errorf("Failed to get NTP time: %v", err)
@@ -242,6 +265,8 @@ func runNTP(ctx context.Context) chan bool {
 				klog.Errorf("got invalid time from NTP server: %v", err)
 				continue
 			}
+			// Keep bootTime relative to the new clock so uptime doesn't jump.
+			bootTime.Add(int64(time.Until(ntpR.Time)))
 			applet.ARM.SetTimer(ntpR.Time.UnixNano())
 
 			// We've got some sort of sensible time set now, so check in with NTP
@@ -405,22 +430,43 @@ func startNetworking() (err error) {
 	}
 	// hook interface into Go runtime
 	net.SocketFunc = iface.Socket
-	http.DefaultClient = &http.Client{
-		Timeout: httpTimeout,
-		Transport: &http.Transport{
-			DialContext: dnscache.DialFunc(resolver, (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext),
-			DisableKeepAlives:     true,
-			ForceAttemptHTTP2:     false,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			ResponseHeaderTimeout: 10 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
+
+	// An invalid proxy URL should have been caught by the Makefile. If one
+	// gets through, connect directly rather than fail, since exiting here
+	// would also stop the applet from fetching a fixed update.
+	proxyFunc, err := proxy.ForURL(httpProxyURL)
+	if err != nil {
+		klog.Errorf("Ignoring invalid HTTP proxy URL, connecting directly: %v", err)
+		proxyFunc = nil
+	} else if proxyFunc != nil {
+		klog.Infof("Using HTTP proxy %s", httpProxyURL)
+	}
+	upstream = &health.Tracker{
+		Base: &retry.Transport{
+			Base: &http.Transport{
+				Proxy: proxyFunc,
+				DialContext: dnscache.DialFunc(resolver, (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext),
+				DisableKeepAlives:     true,
+				ForceAttemptHTTP2:     false,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+			MaxAttempts: httpMaxAttempts,
+			BaseDelay:   httpRetryBaseDelay,
+			MaxDelay:    httpRetryMaxDelay,
 		},
 	}
+	// Note that httpTimeout bounds the overall request, including any retries.
+	http.DefaultClient = &http.Client{
+		Timeout:   httpTimeout,
+		Transport: upstream,
+	}
 
 	return
 }
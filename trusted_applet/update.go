@@ -42,6 +42,11 @@ var (
 	updateLogVerifier                    string
 	updateAppletVerifier                 string
 	updateOSVerifier1, updateOSVerifier2 string
+
+	// updateWindow optionally restricts when updates found by the periodic
+	// check are installed, as a daily "HH:MM-HH:MM" range of UTC times.
+	// Updates requested via /updatecheck are installed regardless.
+	updateWindow string
 )
 
 // updater returns an updater struct configured from the compiled-in